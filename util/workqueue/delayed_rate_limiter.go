@@ -0,0 +1,151 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// DelayedRateLimiter wraps a RateLimiter[T] that starts out inactive: until it is armed via Start or
+// SetLimiter plus a trigger, When always returns 0 so items are admitted immediately. Once armed, it
+// forwards to the underlying limiter for the rest of its life. This lets a controller admit a burst of
+// items at startup (e.g. resync after cache warmup) and then fall back to normal rate limiting.
+//
+// DelayedRateLimiter is safe for concurrent use.
+type DelayedRateLimiter[T comparable] struct {
+	mu      sync.RWMutex
+	limiter RateLimiter[T]
+	active  bool
+}
+
+var _ RateLimiter[string] = &DelayedRateLimiter[string]{}
+
+// NewDelayedRateLimiter constructs a DelayedRateLimiter that is inactive until Start (or SetLimiter
+// followed by some other activation) is called.
+func NewDelayedRateLimiter[T comparable](limiter RateLimiter[T]) *DelayedRateLimiter[T] {
+	return &DelayedRateLimiter[T]{limiter: limiter}
+}
+
+// SetLimiter configures the RateLimiter that will be used once the DelayedRateLimiter is active. It
+// is for pre-activation setup only: once the DelayedRateLimiter has activated, per-item counters
+// have already been recorded against the current limiter, and swapping it out would silently drop
+// them, in conflict with NumRequeues/Forget's contract to reflect an item's real history. Calling
+// SetLimiter after activation is rejected (reported via utilruntime.HandleError) and leaves the
+// existing limiter in place; construct a new DelayedRateLimiter if you need a different one mid-life.
+func (r *DelayedRateLimiter[T]) SetLimiter(limiter RateLimiter[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active {
+		utilruntime.HandleError(fmt.Errorf("workqueue: SetLimiter called on an already-active DelayedRateLimiter; ignoring"))
+		return
+	}
+	r.limiter = limiter
+}
+
+// Start arms the DelayedRateLimiter after d has elapsed.
+func (r *DelayedRateLimiter[T]) Start(d time.Duration) {
+	if d <= 0 {
+		r.activate()
+		return
+	}
+	r.StartAfter(time.After(d))
+}
+
+// StartAfter arms the DelayedRateLimiter as soon as ready fires. It's useful when activation is
+// triggered by an external event (e.g. a cache sync) rather than a fixed duration.
+func (r *DelayedRateLimiter[T]) StartAfter(ready <-chan time.Time) {
+	go func() {
+		<-ready
+		r.activate()
+	}()
+}
+
+// StartWhen arms the DelayedRateLimiter as soon as ready is closed or receives a value.
+func (r *DelayedRateLimiter[T]) StartWhen(ready <-chan struct{}) {
+	go func() {
+		<-ready
+		r.activate()
+	}()
+}
+
+func (r *DelayedRateLimiter[T]) activate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = true
+}
+
+// isActive reports whether the DelayedRateLimiter has activated. It exists for tests.
+func (r *DelayedRateLimiter[T]) isActive() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active
+}
+
+// When returns 0 until the DelayedRateLimiter has been activated. The underlying limiter's When is
+// still invoked whenever a limiter is set, so its per-item requeue counter keeps advancing across the
+// switch even while admission is unthrottled.
+func (r *DelayedRateLimiter[T]) When(item T) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.limiter == nil {
+		return 0
+	}
+
+	delay := r.limiter.When(item)
+	if !r.active {
+		return 0
+	}
+	return delay
+}
+
+// Forget forwards to the currently configured limiter, if any.
+func (r *DelayedRateLimiter[T]) Forget(item T) {
+	r.mu.RLock()
+	limiter := r.limiter
+	r.mu.RUnlock()
+
+	if limiter != nil {
+		limiter.Forget(item)
+	}
+}
+
+// NumRequeues forwards to the currently configured limiter, if any.
+func (r *DelayedRateLimiter[T]) NumRequeues(item T) int {
+	r.mu.RLock()
+	limiter := r.limiter
+	r.mu.RUnlock()
+
+	if limiter == nil {
+		return 0
+	}
+	return limiter.NumRequeues(item)
+}
+
+// NewDelayedRateLimitingQueueWithConfig constructs a RateLimitingInterface whose rate limiter starts
+// out inactive (admitting everything immediately) and switches to limiter once activateAt has passed.
+// If activateAt is already in the past, the queue is rate limited from the start.
+func NewDelayedRateLimitingQueueWithConfig[T comparable](limiter RateLimiter[T], activateAt time.Time, config RateLimitingQueueConfig[T]) RateLimitingInterface[T] {
+	delayed := NewDelayedRateLimiter[T](limiter)
+	delayed.Start(time.Until(activateAt))
+	return NewRateLimitingQueueWithConfig[T](delayed, config)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayedRateLimiterStartsInactive(t *testing.T) {
+	inner := newConstantRateLimiter(time.Hour)
+	r := NewDelayedRateLimiter[string](inner)
+
+	if got := r.When("item"); got != 0 {
+		t.Fatalf("expected an inactive limiter to return 0 delay, got %s", got)
+	}
+	if got := inner.NumRequeues("item"); got != 1 {
+		t.Fatalf("expected the wrapped limiter's counter to still advance while inactive, got %d", got)
+	}
+}
+
+func TestDelayedRateLimiterActivatesOnTrigger(t *testing.T) {
+	inner := newConstantRateLimiter(time.Hour)
+	r := NewDelayedRateLimiter[string](inner)
+
+	ready := make(chan struct{})
+	r.StartWhen(ready)
+	close(ready)
+
+	deadline := time.Now().Add(time.Second)
+	for !r.isActive() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for DelayedRateLimiter to activate")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := r.When("item"); got != time.Hour {
+		t.Fatalf("expected an active limiter to forward the wrapped limiter's delay, got %s", got)
+	}
+}
+
+func TestDelayedRateLimiterSetLimiterAfterActivationIsRejected(t *testing.T) {
+	first := newConstantRateLimiter(time.Hour)
+	r := NewDelayedRateLimiter[string](first)
+	r.Start(0) // activates immediately
+
+	deadline := time.Now().Add(time.Second)
+	for !r.isActive() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for activation")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	second := newConstantRateLimiter(time.Minute)
+	r.SetLimiter(second)
+
+	if got := r.When("item"); got != time.Hour {
+		t.Fatalf("expected SetLimiter to be rejected once active and keep the original limiter, got delay %s", got)
+	}
+}
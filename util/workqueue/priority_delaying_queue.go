@@ -0,0 +1,412 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/clock"
+)
+
+// PriorityDelayingInterface is a DelayingInterface that additionally lets callers attach a priority
+// to a delayed item, so that once multiple items become ready at (approximately) the same time, the
+// higher priority ones are surfaced first.
+type PriorityDelayingInterface[T comparable] interface {
+	DelayingInterface[T]
+
+	// AddAfterWithPriority adds an item to the workqueue after the indicated duration has passed,
+	// recording priority for use once the item becomes ready. Re-adding an item that is still
+	// pending upgrades its priority and readiness time in place instead of queuing a duplicate.
+	AddAfterWithPriority(item T, duration time.Duration, priority int)
+}
+
+// PriorityDelayingQueueConfig specifies optional configurations to customize a PriorityDelayingInterface.
+type PriorityDelayingQueueConfig[T comparable] struct {
+	// Name for the queue. If unnamed, the metrics will not be registered.
+	Name string
+
+	// MetricsProvider optionally allows specifying a metrics provider to use for the queue
+	// instead of the global provider.
+	MetricsProvider MetricsProvider
+
+	// Clock optionally allows injecting a real or fake clock for testing purposes.
+	Clock clock.WithTicker
+
+	// Queue optionally allows injecting custom queue Interface instead of the default one.
+	Queue Interface[T]
+
+	// DefaultPriority is the priority used for items added via AddAfter. Items added via Add go
+	// straight to the base queue and carry no priority.
+	DefaultPriority int
+}
+
+// NewPriorityDelayingQueue constructs a new workqueue with delayed, priority-ordered queuing ability.
+// NewPriorityDelayingQueue does not emit metrics. For use with a MetricsProvider, please use
+// NewPriorityDelayingQueueWithConfig instead.
+func NewPriorityDelayingQueue[T comparable]() PriorityDelayingInterface[T] {
+	return NewPriorityDelayingQueueWithConfig[T](PriorityDelayingQueueConfig[T]{})
+}
+
+// NewPriorityDelayingQueueWithConfig constructs a new workqueue with delayed, priority-ordered queuing
+// ability, with options to customize different properties.
+func NewPriorityDelayingQueueWithConfig[T comparable](config PriorityDelayingQueueConfig[T]) PriorityDelayingInterface[T] {
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+
+	if config.Queue == nil {
+		config.Queue = NewWithConfig[T](QueueConfig[T]{
+			Name:            config.Name,
+			MetricsProvider: config.MetricsProvider,
+			Clock:           config.Clock,
+		})
+	}
+
+	ret := &priorityDelayingType[T]{
+		Interface:          config.Queue,
+		clock:              config.Clock,
+		heartbeat:          config.Clock.NewTicker(maxWait),
+		stopCh:             make(chan struct{}),
+		waitingForAddCh:    make(chan *priorityWaitFor[T], 1000),
+		metrics:            newRetryMetrics(config.Name, config.MetricsProvider),
+		defaultPriority:    config.DefaultPriority,
+		waitingForQueue:    &priorityWaitForQueue[T]{},
+		waitingEntryByData: map[T]*priorityWaitFor[T]{},
+	}
+	heap.Init(ret.waitingForQueue)
+
+	go ret.waitingLoop()
+
+	return ret
+}
+
+// priorityWaitFor holds the data to add, the time it should be added, and the priority it should be
+// added with once ready.
+type priorityWaitFor[T any] struct {
+	data     T
+	readyAt  time.Time
+	priority int
+	// index in the priority queue (heap)
+	index int
+}
+
+// priorityWaitForQueue implements a priority queue for priorityWaitFor items, ordered by readyAt. It
+// implements heap.Interface; the item that should fire next is always at index 0.
+//
+// Less only tie-breaks on priority when two entries have the exact same readyAt, which in practice is
+// rare: AddAfterWithPriority stamps readyAt from an independent clock.Now().Add(duration) call per
+// item, so two items "added together" almost never land on bit-for-bit-equal timestamps. That's fine —
+// Less only needs to produce a valid heap ordering. The actual priority-ordering guarantee (higher
+// priority items surface first once multiple items are ready) comes from waitingLoop, which pops every
+// entry whose delay has already elapsed into a batch and sorts that batch by priority before adding it
+// to the base queue, rather than relying on heap comparisons between not-yet-popped entries.
+type priorityWaitForQueue[T any] []*priorityWaitFor[T]
+
+func (pq priorityWaitForQueue[T]) Len() int {
+	return len(pq)
+}
+
+func (pq priorityWaitForQueue[T]) Less(i, j int) bool {
+	if pq[i].readyAt.Equal(pq[j].readyAt) {
+		return pq[i].priority > pq[j].priority
+	}
+	return pq[i].readyAt.Before(pq[j].readyAt)
+}
+
+func (pq priorityWaitForQueue[T]) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].index = i
+	pq[j].index = j
+}
+
+// Push adds an item to the queue. Push should not be called directly; instead use `heap.Push`.
+func (pq *priorityWaitForQueue[T]) Push(x interface{}) {
+	n := len(*pq)
+	item := x.(*priorityWaitFor[T])
+	item.index = n
+	*pq = append(*pq, item)
+}
+
+// Pop removes an item from the queue. Pop should not be called directly; instead use `heap.Pop`.
+func (pq *priorityWaitForQueue[T]) Pop() interface{} {
+	n := len(*pq)
+	item := (*pq)[n-1]
+	(*pq)[n-1] = nil
+	item.index = -1
+	*pq = (*pq)[0 : n-1]
+	return item
+}
+
+// Peek returns the item at the head of the queue without removing it or otherwise mutating the queue.
+// It must not be called on an empty queue.
+func (pq priorityWaitForQueue[T]) Peek() *priorityWaitFor[T] {
+	return pq[0]
+}
+
+// priorityDelayingType wraps an Interface and provides delayed, priority-ordered re-enqueuing.
+type priorityDelayingType[T comparable] struct {
+	Interface[T]
+
+	// clock tracks time for delayed firing
+	clock clock.Clock
+
+	// stopCh lets us signal a shutdown to the waiting loop
+	stopCh chan struct{}
+	// stopOnce guarantees we only close stopCh/stop the heartbeat a single time, regardless of
+	// whether ShutDown or ShutDownWithDrain gets there first.
+	stopOnce sync.Once
+	// drainOnce guarantees drainWaiting runs exactly once. It's intentionally separate from
+	// stopOnce: if a concurrent plain ShutDown() wins the race to stopOnce, ShutDownWithDrain still
+	// empties the waiting heap instead of silently becoming a no-op (see ShutDownWithDrain).
+	drainOnce sync.Once
+
+	// heartbeat ensures we wait no more than maxWait before firing
+	heartbeat clock.Ticker
+
+	// waitingForAddCh is a buffered channel that feeds waitingLoop
+	waitingForAddCh chan *priorityWaitFor[T]
+
+	// metrics counts the number of retries
+	metrics retryMetrics
+
+	// defaultPriority is used for items added via AddAfter.
+	defaultPriority int
+
+	// waitingMu guards waitingForQueue and waitingEntryByData. They are otherwise only mutated by
+	// waitingLoop, but the mutex lets Snapshot/Peek answer introspection queries from other
+	// goroutines without disturbing queue state.
+	waitingMu          sync.RWMutex
+	waitingForQueue    *priorityWaitForQueue[T]
+	waitingEntryByData map[T]*priorityWaitFor[T]
+}
+
+func (q *priorityDelayingType[T]) ShutDown() {
+	q.Interface.ShutDown()
+	q.stopOnce.Do(func() {
+		close(q.stopCh)
+		q.heartbeat.Stop()
+	})
+}
+
+// ShutDownWithDrain stops accepting new items. Unlike the embedded Interface's ShutDownWithDrain, it
+// first flushes every item still waiting on its delay into the base queue, so a caller draining the
+// queue (e.g. via RateLimitingInterface.ShutDownAndDrain) doesn't lose in-flight retries that simply
+// hadn't come due yet.
+//
+// drainWaiting and the stopCh/heartbeat teardown are guarded by separate sync.Onces rather than one
+// shared between this method and ShutDown. If a caller races a plain ShutDown() against this method
+// (e.g. a defensive deferred ShutDown alongside an explicit drain elsewhere), a single shared Once
+// would let whichever call wins the race silently skip the other's effects — in particular, ShutDown
+// winning would make drainWaiting never run. Keeping drainOnce independent means the waiting heap is
+// always emptied once this method is called, no matter which shutdown path got there first. The
+// flushed items only reach the base queue if it is not shutting down yet: once a plain ShutDown has
+// shut it down, the base queue discards them.
+func (q *priorityDelayingType[T]) ShutDownWithDrain() {
+	q.drainOnce.Do(q.drainWaiting)
+	q.Interface.ShutDownWithDrain()
+	q.stopOnce.Do(func() {
+		close(q.stopCh)
+		q.heartbeat.Stop()
+	})
+}
+
+// drainWaiting immediately moves every pending (not-yet-ready) item into the base queue, bypassing
+// its remaining delay.
+func (q *priorityDelayingType[T]) drainWaiting() {
+	q.waitingMu.Lock()
+	defer q.waitingMu.Unlock()
+
+	for q.waitingForQueue.Len() > 0 {
+		entry := heap.Pop(q.waitingForQueue).(*priorityWaitFor[T])
+		delete(q.waitingEntryByData, entry.data)
+		q.Add(entry.data)
+	}
+}
+
+// AddAfter adds the given item to the work queue after the given delay, using defaultPriority.
+func (q *priorityDelayingType[T]) AddAfter(item T, duration time.Duration) {
+	q.AddAfterWithPriority(item, duration, q.defaultPriority)
+}
+
+// AddAfterWithPriority adds the given item to the work queue after the given delay, recording
+// priority for use once the item becomes ready.
+func (q *priorityDelayingType[T]) AddAfterWithPriority(item T, duration time.Duration, priority int) {
+	// don't add if we're already shutting down
+	if q.ShuttingDown() {
+		return
+	}
+
+	q.metrics.retry()
+
+	// immediately add things with no delay
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+
+	select {
+	case <-q.stopCh:
+	case q.waitingForAddCh <- &priorityWaitFor[T]{data: item, readyAt: q.clock.Now().Add(duration), priority: priority}:
+	}
+}
+
+// waitingLoop runs until the workqueue is shutdown and keeps a check on the list of items to be added.
+func (q *priorityDelayingType[T]) waitingLoop() {
+	defer utilruntime.HandleCrash()
+
+	never := make(<-chan time.Time)
+
+	var nextReadyAtTimer clock.Timer
+
+	for {
+		if q.Interface.ShuttingDown() {
+			return
+		}
+
+		now := q.clock.Now()
+
+		// Pop every entry whose delay has already elapsed into a batch, rather than adding each one
+		// the moment it's popped off the heap. The heap only orders by readyAt, and two entries added
+		// "together" essentially never share a bit-for-bit-equal readyAt (each AddAfterWithPriority
+		// call stamps its own clock.Now().Add(duration)), so adding popped-one-at-a-time would
+		// surface items in whatever order they happened to land in, not by priority. Sorting the
+		// whole ready batch by priority before adding it is what actually delivers "higher priority
+		// items surface first once ready".
+		q.waitingMu.Lock()
+		var ready []*priorityWaitFor[T]
+		for q.waitingForQueue.Len() > 0 {
+			entry := q.waitingForQueue.Peek()
+			if entry.readyAt.After(now) {
+				break
+			}
+
+			entry = heap.Pop(q.waitingForQueue).(*priorityWaitFor[T])
+			delete(q.waitingEntryByData, entry.data)
+			ready = append(ready, entry)
+		}
+
+		// Set up a wait for the first item's readyAt (if one exists)
+		nextReadyAt := never
+		if q.waitingForQueue.Len() > 0 {
+			if nextReadyAtTimer != nil {
+				nextReadyAtTimer.Stop()
+			}
+			entry := q.waitingForQueue.Peek()
+			nextReadyAtTimer = q.clock.NewTimer(entry.readyAt.Sub(now))
+			nextReadyAt = nextReadyAtTimer.C()
+		}
+		q.waitingMu.Unlock()
+
+		if len(ready) > 0 {
+			sort.Slice(ready, func(i, j int) bool {
+				return ready[i].priority > ready[j].priority
+			})
+			for _, entry := range ready {
+				q.Add(entry.data)
+			}
+		}
+
+		select {
+		case <-q.stopCh:
+			return
+
+		case <-q.heartbeat.C():
+			// continue the loop, which will add ready items
+
+		case <-nextReadyAt:
+			// continue the loop, which will add ready items
+
+		case waitEntry := <-q.waitingForAddCh:
+			q.insert(waitEntry)
+
+			drained := false
+			for !drained {
+				select {
+				case waitEntry := <-q.waitingForAddCh:
+					q.insert(waitEntry)
+				default:
+					drained = true
+				}
+			}
+		}
+	}
+}
+
+// insert adds the entry to the priority queue, or upgrades the pending entry in place if one already
+// exists for the same item: readyAt moves earlier and priority moves higher, never the reverse.
+func (q *priorityDelayingType[T]) insert(entry *priorityWaitFor[T]) {
+	if entry.readyAt.Before(q.clock.Now()) {
+		q.Add(entry.data)
+		return
+	}
+
+	q.waitingMu.Lock()
+	defer q.waitingMu.Unlock()
+
+	existing, exists := q.waitingEntryByData[entry.data]
+	if exists {
+		changed := false
+		if existing.readyAt.After(entry.readyAt) {
+			existing.readyAt = entry.readyAt
+			changed = true
+		}
+		if entry.priority > existing.priority {
+			existing.priority = entry.priority
+			changed = true
+		}
+		if changed {
+			heap.Fix(q.waitingForQueue, existing.index)
+		}
+		return
+	}
+
+	heap.Push(q.waitingForQueue, entry)
+	q.waitingEntryByData[entry.data] = entry
+}
+
+// snapshotDelayed reports the number of items still waiting for their delay to expire, and the time
+// at which the earliest of them becomes ready. It does not mutate queue state.
+func (q *priorityDelayingType[T]) snapshotDelayed() (delayed int, nextReadyAt time.Time) {
+	q.waitingMu.RLock()
+	defer q.waitingMu.RUnlock()
+
+	delayed = q.waitingForQueue.Len()
+	if delayed > 0 {
+		nextReadyAt = q.waitingForQueue.Peek().readyAt
+	}
+	return delayed, nextReadyAt
+}
+
+// peekDelay reports the remaining delay for item if it is currently pending in the waiting heap,
+// without mutating queue or rate limiter state.
+func (q *priorityDelayingType[T]) peekDelay(item T) (delay time.Duration, present bool) {
+	q.waitingMu.RLock()
+	defer q.waitingMu.RUnlock()
+
+	entry, ok := q.waitingEntryByData[item]
+	if !ok {
+		return 0, false
+	}
+	if d := entry.readyAt.Sub(q.clock.Now()); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
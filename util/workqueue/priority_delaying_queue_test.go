@@ -0,0 +1,121 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForDelayedCount polls q's introspection until delayed matches want or the deadline passes.
+func waitForDelayedCount[T comparable](t *testing.T, q *priorityDelayingType[T], want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if delayed, _ := q.snapshotDelayed(); delayed == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d waiting items", want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPriorityDelayingQueueReadyOrderByPriority(t *testing.T) {
+	q := NewPriorityDelayingQueueWithConfig[string](PriorityDelayingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	pq := q.(*priorityDelayingType[string])
+
+	q.AddAfterWithPriority("low", 20*time.Millisecond, 1)
+	q.AddAfterWithPriority("high", 20*time.Millisecond, 10)
+	waitForDelayedCount(t, pq, 2)
+
+	time.Sleep(40 * time.Millisecond)
+
+	first, _ := q.Get()
+	if first != "high" {
+		t.Fatalf("expected the higher priority item to become ready first, got %q", first)
+	}
+	second, _ := q.Get()
+	if second != "low" {
+		t.Fatalf("expected the lower priority item second, got %q", second)
+	}
+}
+
+func TestPriorityDelayingQueueUpgradeInPlace(t *testing.T) {
+	q := NewPriorityDelayingQueueWithConfig[string](PriorityDelayingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	pq := q.(*priorityDelayingType[string])
+
+	q.AddAfterWithPriority("item", time.Hour, 1)
+	waitForDelayedCount(t, pq, 1)
+
+	// Re-adding with a higher priority and a much shorter delay should upgrade the pending entry in
+	// place rather than queuing a duplicate.
+	q.AddAfterWithPriority("item", 10*time.Millisecond, 5)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		delay, present := pq.peekDelay("item")
+		if present && delay <= 10*time.Millisecond {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for upgrade to take effect (present=%v, delay=%s)", present, delay)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if delayed, _ := pq.snapshotDelayed(); delayed != 1 {
+		t.Fatalf("expected upgrade-in-place to keep a single pending entry, got %d", delayed)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	item, _ := q.Get()
+	if item != "item" {
+		t.Fatalf("expected the upgraded item to become ready, got %q", item)
+	}
+}
+
+func TestPriorityDelayingQueueDrainWaitingFlushesPendingItems(t *testing.T) {
+	q := NewPriorityDelayingQueueWithConfig[string](PriorityDelayingQueueConfig[string]{})
+	pq := q.(*priorityDelayingType[string])
+
+	q.AddAfterWithPriority("item", time.Hour, 0)
+	waitForDelayedCount(t, pq, 1)
+
+	pq.drainWaiting()
+
+	if delayed, _ := pq.snapshotDelayed(); delayed != 0 {
+		t.Fatalf("expected drainWaiting to empty the waiting heap, got %d still pending", delayed)
+	}
+
+	item, shuttingDown := q.Get()
+	if shuttingDown {
+		t.Fatalf("expected to retrieve the drained item")
+	}
+	if item != "item" {
+		t.Fatalf("expected the drained item, got %q", item)
+	}
+	q.Done(item)
+	q.ShutDown()
+}
@@ -0,0 +1,388 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// RequeueState captures the per-item state an exponential-backoff RateLimiter needs in order to
+// resume where it left off after a restart, instead of resetting to zero and hammering the API
+// server the way a crash-looping pod otherwise would.
+type RequeueState struct {
+	// Requeues is the value NumRequeues would have returned for this item just before the restart.
+	Requeues int
+
+	// LastRequeueAt is when the item was last passed to AddRateLimited. Stores that want to expire
+	// stale entries can use it to decide when a counter is old enough to drop.
+	LastRequeueAt time.Time
+}
+
+// RequeueSeeder is implemented by per-item RateLimiters that can have an item's requeue counter set
+// directly, as an alternative to deriving it by calling When repeatedly. Only per-item limiters
+// should implement it: a limiter with state shared across items (e.g. a token bucket) has no way to
+// "fast forward" to a persisted count for one item without affecting the budget available to every
+// other item, so it must not implement RequeueSeeder. A RateLimiterStore can only rehydrate limiters
+// that do; others simply start at zero after a restart.
+type RequeueSeeder[T comparable] interface {
+	// SeedRequeues sets item's requeue counter to count, as if When had been called count times,
+	// without applying When's other side effects (e.g. consuming from a shared budget).
+	SeedRequeues(item T, count int)
+}
+
+// RateLimiterStore persists per-item rate limiter state. Implementations must be safe for
+// concurrent use.
+//
+// A store only grows the set of items it knows about through Record; an item's entry is removed only
+// by Evict, or by a Save whose state omits it. A caller that never calls Evict (or some external sweep keyed off
+// RequeueState.LastRequeueAt) will accumulate one entry per distinct item ever seen for the life of
+// the process, which matters for a long-running controller with high item cardinality.
+type RateLimiterStore[T comparable] interface {
+	// Load returns all persisted state, keyed by item. It's called once, when the queue hydrates
+	// its rate limiter at construction time.
+	Load() (map[T]RequeueState, error)
+
+	// Save writes the full state, replacing whatever was previously persisted.
+	Save(state map[T]RequeueState) error
+
+	// Record journals a single item's updated state without requiring a full Save.
+	Record(item T, state RequeueState) error
+
+	// Evict removes item's persisted state entirely, e.g. once the rate limiter has forgotten it
+	// and there's no more backoff history worth keeping. Evicting an item with no persisted state
+	// is a no-op.
+	Evict(item T) error
+}
+
+// MemoryRateLimiterStore is a RateLimiterStore backed by an in-memory map. State doesn't survive
+// process restarts, which makes it useful for tests but not for production crash-loop protection.
+type MemoryRateLimiterStore[T comparable] struct {
+	mu    sync.Mutex
+	state map[T]RequeueState
+}
+
+var _ RateLimiterStore[string] = &MemoryRateLimiterStore[string]{}
+
+// NewMemoryRateLimiterStore constructs an empty MemoryRateLimiterStore.
+func NewMemoryRateLimiterStore[T comparable]() *MemoryRateLimiterStore[T] {
+	return &MemoryRateLimiterStore[T]{state: map[T]RequeueState{}}
+}
+
+func (s *MemoryRateLimiterStore[T]) Load() (map[T]RequeueState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[T]RequeueState, len(s.state))
+	for item, state := range s.state {
+		out[item] = state
+	}
+	return out, nil
+}
+
+func (s *MemoryRateLimiterStore[T]) Save(state map[T]RequeueState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = make(map[T]RequeueState, len(state))
+	for item, st := range state {
+		s.state[item] = st
+	}
+	return nil
+}
+
+func (s *MemoryRateLimiterStore[T]) Record(item T, state RequeueState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		s.state = map[T]RequeueState{}
+	}
+	s.state[item] = state
+	return nil
+}
+
+func (s *MemoryRateLimiterStore[T]) Evict(item T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.state, item)
+	return nil
+}
+
+// defaultFlushInterval is how long FileRateLimiterStore waits after a Record before writing
+// accumulated state to disk, so a busy queue's AddRateLimited/Forget hot path isn't doing a
+// synchronous full-state write (MkdirAll + Marshal + WriteFile + Rename) on every call.
+const defaultFlushInterval = time.Second
+
+// FileRateLimiterStore is a RateLimiterStore that journals state as JSON on the local filesystem,
+// one file per queue. It's meant for single-process controllers that want exponential backoff to
+// survive a crash-loop without standing up an external store.
+//
+// Because it round-trips through encoding/json, T's keys must marshal the way encoding/json marshals
+// map keys: string, integer, or a type implementing encoding.TextMarshaler/TextUnmarshaler.
+//
+// Record debounces disk writes by flushInterval: repeated Record calls within that window coalesce
+// into a single write. Save always writes synchronously, since it's an explicit, infrequent call
+// rather than a per-item hot path. Record's returned error only reflects a synchronous write (when
+// flushInterval is 0); failures from a debounced flush are reported via utilruntime.HandleError
+// since there's no caller left to return them to.
+type FileRateLimiterStore[T comparable] struct {
+	path string
+
+	mu            sync.Mutex
+	state         map[T]RequeueState
+	dirty         bool
+	flushTimer    *time.Timer
+	flushInterval time.Duration
+}
+
+// NewFileRateLimiterStore constructs a FileRateLimiterStore that journals to
+// filepath.Join(dir, name+".json"). name is typically the queue's Name.
+func NewFileRateLimiterStore[T comparable](dir, name string) *FileRateLimiterStore[T] {
+	return &FileRateLimiterStore[T]{
+		path:          filepath.Join(dir, name+".json"),
+		flushInterval: defaultFlushInterval,
+	}
+}
+
+// WithFlushInterval overrides the default debounce interval between a Record call and the disk
+// write that follows it. A zero interval flushes synchronously on every Record, which is only
+// suitable for very low-throughput queues.
+func (s *FileRateLimiterStore[T]) WithFlushInterval(d time.Duration) *FileRateLimiterStore[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushInterval = d
+	return s
+}
+
+func (s *FileRateLimiterStore[T]) Load() (map[T]RequeueState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.state = map[T]RequeueState{}
+		return map[T]RequeueState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading rate limiter store %s: %w", s.path, err)
+	}
+
+	state := map[T]RequeueState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decoding rate limiter store %s: %w", s.path, err)
+	}
+
+	s.state = state
+	out := make(map[T]RequeueState, len(state))
+	for item, st := range state {
+		out[item] = st
+	}
+	return out, nil
+}
+
+func (s *FileRateLimiterStore[T]) Save(state map[T]RequeueState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = make(map[T]RequeueState, len(state))
+	for item, st := range state {
+		s.state[item] = st
+	}
+	s.cancelPendingFlushLocked()
+	s.dirty = false
+	return s.writeLocked()
+}
+
+// Record updates item's state in memory immediately and schedules a debounced write; it does not
+// write to disk itself unless flushInterval is 0. Use Flush to force a synchronous write, e.g.
+// during a graceful shutdown.
+func (s *FileRateLimiterStore[T]) Record(item T, state RequeueState) error {
+	s.mu.Lock()
+
+	if s.state == nil {
+		s.state = map[T]RequeueState{}
+	}
+	s.state[item] = state
+	return s.scheduleWriteLocked()
+}
+
+// Evict removes item's persisted state and schedules a debounced write of the result, the same way
+// Record does.
+func (s *FileRateLimiterStore[T]) Evict(item T) error {
+	s.mu.Lock()
+
+	delete(s.state, item)
+	return s.scheduleWriteLocked()
+}
+
+// scheduleWriteLocked marks the store dirty and either writes synchronously (flushInterval <= 0) or
+// schedules a debounced flush. Callers must hold s.mu on entry; scheduleWriteLocked always releases
+// it before returning.
+func (s *FileRateLimiterStore[T]) scheduleWriteLocked() error {
+	s.dirty = true
+
+	if s.flushInterval <= 0 {
+		defer s.mu.Unlock()
+		err := s.writeLocked()
+		s.dirty = err != nil
+		return err
+	}
+
+	if s.flushTimer == nil {
+		s.flushTimer = time.AfterFunc(s.flushInterval, s.flush)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Flush forces any state accumulated since the last write to be written to disk immediately,
+// bypassing the debounce interval.
+func (s *FileRateLimiterStore[T]) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelPendingFlushLocked()
+	if !s.dirty {
+		return nil
+	}
+	err := s.writeLocked()
+	s.dirty = err != nil
+	return err
+}
+
+// flush is invoked off the hot Record path by flushTimer, so repeated requeues of a busy queue
+// coalesce into one disk write per flushInterval instead of one per item.
+func (s *FileRateLimiterStore[T]) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushTimer = nil
+	if !s.dirty {
+		return
+	}
+	if err := s.writeLocked(); err != nil {
+		utilruntime.HandleError(fmt.Errorf("flushing rate limiter store %s: %w", s.path, err))
+		return
+	}
+	s.dirty = false
+}
+
+// cancelPendingFlushLocked stops any scheduled debounced flush. Callers must hold s.mu.
+func (s *FileRateLimiterStore[T]) cancelPendingFlushLocked() {
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+}
+
+func (s *FileRateLimiterStore[T]) writeLocked() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return fmt.Errorf("encoding rate limiter store %s: %w", s.path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("creating directory for rate limiter store %s: %w", s.path, err)
+	}
+
+	// Write to a temp file and rename so a crash mid-write can't leave a truncated store behind.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing rate limiter store %s: %w", s.path, err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// storeBackedRateLimiter wraps a RateLimiter[T], hydrating it from a RateLimiterStore at
+// construction and journaling every change back to the store so counters survive a restart.
+type storeBackedRateLimiter[T comparable] struct {
+	RateLimiter[T]
+	store RateLimiterStore[T]
+}
+
+var _ RequeueSeeder[string] = &storeBackedRateLimiter[string]{}
+
+// newStoreBackedRateLimiter hydrates limiter from store and returns a RateLimiter[T] that keeps
+// the store up to date as limiter is used.
+func newStoreBackedRateLimiter[T comparable](limiter RateLimiter[T], store RateLimiterStore[T]) (RateLimiter[T], error) {
+	saved, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading rate limiter state: %w", err)
+	}
+
+	// Never hydrate by replaying When against the live limiter: for a limiter with state shared
+	// across items (e.g. the token bucket behind DefaultControllerRateLimiter), that would drain the
+	// shared budget by the persisted count before the queue has processed a single real item,
+	// throttling unrelated items for no reason. Only limiters that opt in via RequeueSeeder can be
+	// rehydrated; others simply restart their counters at zero.
+	if seeder, ok := limiter.(RequeueSeeder[T]); ok {
+		for item, state := range saved {
+			seeder.SeedRequeues(item, state.Requeues)
+		}
+	} else if len(saved) > 0 {
+		utilruntime.HandleError(fmt.Errorf("rate limiter %T does not implement RequeueSeeder; skipping hydration of %d persisted item(s)", limiter, len(saved)))
+	}
+
+	return &storeBackedRateLimiter[T]{RateLimiter: limiter, store: store}, nil
+}
+
+func (r *storeBackedRateLimiter[T]) When(item T) time.Duration {
+	delay := r.RateLimiter.When(item)
+	if err := r.store.Record(item, RequeueState{Requeues: r.RateLimiter.NumRequeues(item), LastRequeueAt: time.Now()}); err != nil {
+		utilruntime.HandleError(fmt.Errorf("recording rate limiter state: %w", err))
+	}
+	return delay
+}
+
+// Forget forwards to the wrapped limiter and evicts item's persisted state, since a forgotten item
+// has no more backoff history worth keeping. Evicting rather than recording a zero-value RequeueState
+// keeps the store's size bounded by the number of items currently being retried, instead of growing
+// by one entry per distinct item ever seen.
+func (r *storeBackedRateLimiter[T]) Forget(item T) {
+	r.RateLimiter.Forget(item)
+	if err := r.store.Evict(item); err != nil {
+		utilruntime.HandleError(fmt.Errorf("evicting rate limiter state: %w", err))
+	}
+}
+
+// SeedRequeues forwards to the wrapped limiter if it implements RequeueSeeder, and journals the
+// corrected count to the store. It exists so storeBackedRateLimiter itself satisfies RequeueSeeder:
+// embedding RateLimiter[T] as an interface field only promotes the methods RateLimiter[T] declares
+// (When/Forget/NumRequeues), not any extra method the concrete wrapped limiter happens to implement.
+// Without this, code that type-asserts a configured rateLimiter against RequeueSeeder (e.g.
+// rateLimitingType.undoRequeue, rolling back a requeue count after a cancelled
+// AddRateLimitedWithContext) would always fail the assertion once a Store is configured, even though
+// the wrapped limiter supports seeding.
+func (r *storeBackedRateLimiter[T]) SeedRequeues(item T, count int) {
+	seeder, ok := r.RateLimiter.(RequeueSeeder[T])
+	if !ok {
+		return
+	}
+
+	seeder.SeedRequeues(item, count)
+	if err := r.store.Record(item, RequeueState{Requeues: count, LastRequeueAt: time.Now()}); err != nil {
+		utilruntime.HandleError(fmt.Errorf("recording rate limiter state: %w", err))
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// constantRateLimiter is a per-item test double: it tracks a requeue count per item and always
+// returns the same delay. It's shared by several test files in this package.
+type constantRateLimiter struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	requeues map[string]int
+}
+
+func newConstantRateLimiter(delay time.Duration) *constantRateLimiter {
+	return &constantRateLimiter{delay: delay, requeues: map[string]int{}}
+}
+
+func (c *constantRateLimiter) When(item string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requeues[item]++
+	return c.delay
+}
+
+func (c *constantRateLimiter) Forget(item string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.requeues, item)
+}
+
+func (c *constantRateLimiter) NumRequeues(item string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requeues[item]
+}
+
+// seededRateLimiter additionally implements RequeueSeeder, as a per-item limiter capable of
+// rehydration would.
+type seededRateLimiter struct {
+	*constantRateLimiter
+}
+
+var _ RequeueSeeder[string] = &seededRateLimiter{}
+
+func (s *seededRateLimiter) SeedRequeues(item string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requeues[item] = count
+}
+
+func TestNewStoreBackedRateLimiterSeedsWithoutReplaying(t *testing.T) {
+	store := NewMemoryRateLimiterStore[string]()
+	if err := store.Record("item", RequeueState{Requeues: 5}); err != nil {
+		t.Fatalf("unexpected error priming store: %v", err)
+	}
+
+	limiter := &seededRateLimiter{constantRateLimiter: newConstantRateLimiter(time.Second)}
+	if _, err := newStoreBackedRateLimiter[string](limiter, store); err != nil {
+		t.Fatalf("unexpected error hydrating: %v", err)
+	}
+
+	if got := limiter.NumRequeues("item"); got != 5 {
+		t.Fatalf("expected seeded counter of 5, got %d", got)
+	}
+}
+
+func TestNewStoreBackedRateLimiterSkipsHydrationWithoutSeeder(t *testing.T) {
+	store := NewMemoryRateLimiterStore[string]()
+	if err := store.Record("item", RequeueState{Requeues: 5}); err != nil {
+		t.Fatalf("unexpected error priming store: %v", err)
+	}
+
+	// A limiter that does not implement RequeueSeeder might have state shared across items (e.g. a
+	// token bucket), so hydration must not replay When against it: that would consume shared budget
+	// on behalf of unrelated items before the queue has processed anything real.
+	limiter := newConstantRateLimiter(time.Second)
+	if _, err := newStoreBackedRateLimiter[string](limiter, store); err != nil {
+		t.Fatalf("unexpected error hydrating: %v", err)
+	}
+
+	if got := limiter.NumRequeues("item"); got != 0 {
+		t.Fatalf("expected hydration to skip a non-seedable limiter, got %d requeues", got)
+	}
+}
+
+func TestFileRateLimiterStoreDebouncesWrites(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileRateLimiterStore[string](dir, "queue").WithFlushInterval(20 * time.Millisecond)
+	path := filepath.Join(dir, "queue.json")
+
+	for i := 0; i < 5; i++ {
+		if err := store.Record("item", RequeueState{Requeues: i}); err != nil {
+			t.Fatalf("unexpected error recording: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("expected writes to be debounced, but %s was already written", path)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if data, err := os.ReadFile(path); err == nil {
+			if len(data) == 0 {
+				t.Fatalf("expected non-empty flushed state")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for debounced flush to write %s", path)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryRateLimiterStoreEvictRemovesState(t *testing.T) {
+	store := NewMemoryRateLimiterStore[string]()
+	if err := store.Record("item", RequeueState{Requeues: 3}); err != nil {
+		t.Fatalf("unexpected error recording: %v", err)
+	}
+
+	if err := store.Evict("item"); err != nil {
+		t.Fatalf("unexpected error evicting: %v", err)
+	}
+
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	if _, present := saved["item"]; present {
+		t.Fatalf("expected evicted item to be absent from the store, got %+v", saved["item"])
+	}
+
+	// Evicting an item with no persisted state is a no-op, not an error.
+	if err := store.Evict("unknown"); err != nil {
+		t.Fatalf("unexpected error evicting an unknown item: %v", err)
+	}
+}
+
+func TestFileRateLimiterStoreEvictRemovesState(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileRateLimiterStore[string](dir, "queue").WithFlushInterval(0)
+
+	if err := store.Record("item", RequeueState{Requeues: 3}); err != nil {
+		t.Fatalf("unexpected error recording: %v", err)
+	}
+	if err := store.Evict("item"); err != nil {
+		t.Fatalf("unexpected error evicting: %v", err)
+	}
+
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	if _, present := saved["item"]; present {
+		t.Fatalf("expected evicted item to be absent from the reloaded store, got %+v", saved["item"])
+	}
+}
+
+func TestStoreBackedRateLimiterForgetEvictsRatherThanRecording(t *testing.T) {
+	store := NewMemoryRateLimiterStore[string]()
+	limiter := newConstantRateLimiter(time.Second)
+
+	wrapped, err := newStoreBackedRateLimiter[string](limiter, store)
+	if err != nil {
+		t.Fatalf("unexpected error constructing: %v", err)
+	}
+
+	wrapped.When("item")
+	wrapped.Forget("item")
+
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	if _, present := saved["item"]; present {
+		t.Fatalf("expected Forget to evict item from the store entirely, got %+v", saved["item"])
+	}
+}
+
+func TestStoreBackedRateLimiterSeedRequeuesForwardsAndJournals(t *testing.T) {
+	store := NewMemoryRateLimiterStore[string]()
+	limiter := &seededRateLimiter{constantRateLimiter: newConstantRateLimiter(time.Second)}
+
+	wrapped, err := newStoreBackedRateLimiter[string](limiter, store)
+	if err != nil {
+		t.Fatalf("unexpected error constructing: %v", err)
+	}
+
+	// storeBackedRateLimiter must itself satisfy RequeueSeeder: embedding RateLimiter[T] as an
+	// interface field only promotes the methods that interface declares, not SeedRequeues, which
+	// lives on the concrete wrapped limiter.
+	seeder, ok := wrapped.(RequeueSeeder[string])
+	if !ok {
+		t.Fatalf("expected storeBackedRateLimiter to implement RequeueSeeder when wrapping a seedable limiter")
+	}
+
+	seeder.SeedRequeues("item", 7)
+
+	if got := limiter.NumRequeues("item"); got != 7 {
+		t.Fatalf("expected SeedRequeues to forward to the wrapped limiter, got %d", got)
+	}
+
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	if saved["item"].Requeues != 7 {
+		t.Fatalf("expected SeedRequeues to journal the corrected count, got %+v", saved["item"])
+	}
+}
+
+func TestFileRateLimiterStoreFlushForcesWrite(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileRateLimiterStore[string](dir, "queue").WithFlushInterval(time.Hour)
+	path := filepath.Join(dir, "queue.json")
+
+	if err := store.Record("item", RequeueState{Requeues: 1}); err != nil {
+		t.Fatalf("unexpected error recording: %v", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("expected the long flush interval to delay the write")
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected Flush to write %s synchronously: %v", path, err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAddRateLimitedWithContextPreservesPriorHistoryOnCancel(t *testing.T) {
+	limiter := &seededRateLimiter{constantRateLimiter: newConstantRateLimiter(time.Hour)}
+	q := NewPriorityRateLimitingQueueWithConfig[string](limiter, PriorityRateLimitingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	// Build up real prior backoff history before the cancelled attempt.
+	for i := 0; i < 3; i++ {
+		limiter.When("item")
+	}
+	if got := q.NumRequeues("item"); got != 3 {
+		t.Fatalf("expected 3 prior requeues, got %d", got)
+	}
+
+	// Cancel only after When has counted the attempt (the limiter's delay is an hour), so the
+	// rollback path runs.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := q.AddRateLimitedWithContext(ctx, "item"); err == nil {
+		t.Fatalf("expected a cancelled context to return an error")
+	}
+
+	if got := q.NumRequeues("item"); got != 3 {
+		t.Fatalf("expected cancellation to restore the prior requeue count of 3, got %d", got)
+	}
+}
+
+func TestAddRateLimitedWithContextRejectsAlreadyCancelledContext(t *testing.T) {
+	limiter := newConstantRateLimiter(time.Hour)
+	q := NewPriorityRateLimitingQueueWithConfig[string](limiter, PriorityRateLimitingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := q.AddRateLimitedWithContext(ctx, "item"); err == nil {
+		t.Fatalf("expected an already-cancelled context to be rejected before calling When")
+	}
+	if got := q.NumRequeues("item"); got != 0 {
+		t.Fatalf("expected no requeue to be counted for a pre-cancelled context, got %d", got)
+	}
+}
+
+func TestShutDownAndDrainFlushesDelayedItems(t *testing.T) {
+	limiter := newConstantRateLimiter(time.Hour)
+	q := NewPriorityRateLimitingQueueWithConfig[string](limiter, PriorityRateLimitingQueueConfig[string]{})
+
+	q.AddRateLimited("item")
+
+	deadline := time.Now().Add(time.Second)
+	for q.Snapshot().Delayed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for item to become delayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- q.ShutDownAndDrain(context.Background())
+	}()
+
+	item, shuttingDown := q.Get()
+	if shuttingDown {
+		t.Fatalf("expected to retrieve the flushed item before shutdown completes")
+	}
+	if item != "item" {
+		t.Fatalf("expected the delayed item to be flushed into the base queue, got %q", item)
+	}
+	q.Done(item)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected ShutDownAndDrain to succeed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for ShutDownAndDrain to finish draining")
+	}
+}
+
+func TestShutDownAndDrainRespectsContext(t *testing.T) {
+	limiter := newConstantRateLimiter(time.Hour)
+	q := NewPriorityRateLimitingQueueWithConfig[string](limiter, PriorityRateLimitingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	q.AddRateLimited("item") // nothing ever calls Get/Done, so the drain can't finish on its own
+
+	deadline := time.Now().Add(time.Second)
+	for q.Snapshot().Delayed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for item to become delayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := q.ShutDownAndDrain(ctx); err == nil {
+		t.Fatalf("expected ShutDownAndDrain to time out while the flushed item is never marked Done")
+	}
+}
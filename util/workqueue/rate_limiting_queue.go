@@ -16,7 +16,14 @@ limitations under the License.
 
 package workqueue
 
-import "k8s.io/utils/clock"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/clock"
+)
 
 // RateLimitingInterface is an interface that rate limits items being added to the queue.
 type RateLimitingInterface[T comparable] interface {
@@ -25,6 +32,12 @@ type RateLimitingInterface[T comparable] interface {
 	// AddRateLimited adds an item to the workqueue after the rate limiter says it's ok
 	AddRateLimited(item T)
 
+	// AddRateLimitedWithPriority behaves like AddRateLimited, but additionally hints that item
+	// should be surfaced ahead of other items whose delay has also expired once priority is
+	// higher. Queues built over a DelayingInterface that doesn't implement PriorityDelayingInterface
+	// fall back to AddRateLimited and ignore priority.
+	AddRateLimitedWithPriority(item T, priority int)
+
 	// Forget indicates that an item is finished being retried.  Doesn't matter whether it's for perm failing
 	// or for success, we'll stop the rate limiter from tracking it.  This only clears the `rateLimiter`, you
 	// still have to call `Done` on the queue.
@@ -32,6 +45,49 @@ type RateLimitingInterface[T comparable] interface {
 
 	// NumRequeues returns back how many times the item was requeued
 	NumRequeues(item T) int
+
+	// Snapshot reports the current counts of ready and delayed items, for building health and
+	// metrics endpoints. It does not mutate queue or rate limiter state.
+	Snapshot() RateLimitingSnapshot[T]
+
+	// Peek reports item's current backoff delay and requeue count without mutating rate limiter
+	// state. present is false if item isn't currently known to the queue's delaying layer.
+	Peek(item T) (delay time.Duration, requeues int, present bool)
+
+	// AddRateLimitedWithContext is like AddRateLimited, but aborts insertion if ctx is cancelled
+	// before the computed delay elapses. On such a cancellation, a rate limiter that implements
+	// RequeueSeeder has its requeue count restored to the value it had before this call; with any
+	// other rate limiter, the requeue this call counted stays counted.
+	AddRateLimitedWithContext(ctx context.Context, item T) error
+
+	// ShutDownAndDrain stops accepting new items, immediately flushes all pending delayed items
+	// into the base queue, and blocks until every outstanding item has been marked Done or ctx is
+	// done, whichever happens first.
+	ShutDownAndDrain(ctx context.Context) error
+}
+
+// RateLimitingSnapshot summarizes the current state of a RateLimitingInterface's queue and rate
+// limiter, for building controller health/metrics endpoints without having to shadow queue state
+// externally.
+type RateLimitingSnapshot[T comparable] struct {
+	// Ready is the number of items that have cleared their rate-limit delay and are waiting to be
+	// handed out via Get.
+	Ready int
+
+	// Delayed is the number of items still waiting for their rate-limit delay to expire.
+	Delayed int
+
+	// NextReadyAt is the time at which the next delayed item becomes ready. It is the zero Time if
+	// Delayed is 0.
+	NextReadyAt time.Time
+}
+
+// delayedSnapshotter is implemented by delaying queues that can report their pending/ready state
+// without mutating their internals. A DelayingInterface that doesn't implement it (e.g. a
+// caller-supplied one) is reported as having no delayed items.
+type delayedSnapshotter[T comparable] interface {
+	snapshotDelayed() (delayed int, nextReadyAt time.Time)
+	peekDelay(item T) (delay time.Duration, present bool)
 }
 
 // RateLimitingQueueConfig specifies optional configurations to customize a RateLimitingInterface.
@@ -49,6 +105,10 @@ type RateLimitingQueueConfig[T comparable] struct {
 
 	// DelayingQueue optionally allows injecting custom delaying queue DelayingInterface instead of the default one.
 	DelayingQueue DelayingInterface[T]
+
+	// Store optionally persists rate limiter state so exponential backoff counters survive a
+	// controller restart instead of resetting to zero and hammering the API server.
+	Store RateLimiterStore[T]
 }
 
 // NewRateLimitingQueue constructs a new workqueue with rateLimited queuing ability
@@ -67,6 +127,15 @@ func NewRateLimitingQueueWithConfig[T comparable](rateLimiter RateLimiter[T], co
 		config.Clock = clock.RealClock{}
 	}
 
+	if config.Store != nil {
+		persisted, err := newStoreBackedRateLimiter(rateLimiter, config.Store)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("hydrating rate limiter for queue %q: %w", config.Name, err))
+		} else {
+			rateLimiter = persisted
+		}
+	}
+
 	if config.DelayingQueue == nil {
 		config.DelayingQueue = NewDelayingQueueWithConfig(DelayingQueueConfig[T]{
 			Name:            config.Name,
@@ -81,6 +150,51 @@ func NewRateLimitingQueueWithConfig[T comparable](rateLimiter RateLimiter[T], co
 	}
 }
 
+// PriorityRateLimitingQueueConfig specifies optional configurations to customize a RateLimitingInterface
+// whose DelayingQueue supports priority ordering.
+type PriorityRateLimitingQueueConfig[T comparable] struct {
+	// Name for the queue. If unnamed, the metrics will not be registered.
+	Name string
+
+	// MetricsProvider optionally allows specifying a metrics provider to use for the queue
+	// instead of the global provider.
+	MetricsProvider MetricsProvider
+
+	// Clock optionally allows injecting a real or fake clock for testing purposes.
+	Clock clock.WithTicker
+
+	// DelayingQueue optionally allows injecting a custom priority delaying queue instead of the default one.
+	DelayingQueue PriorityDelayingInterface[T]
+
+	// DefaultPriority is the priority used for items added via AddRateLimited or AddAfter. Items
+	// added via AddRateLimitedWithPriority or AddAfterWithPriority use their own priority instead;
+	// items added via Add go straight to the base queue and carry no priority.
+	DefaultPriority int
+}
+
+// NewPriorityRateLimitingQueueWithConfig constructs a new workqueue with rateLimited queuing ability whose
+// underlying delaying queue orders ready items by priority in addition to readiness time.
+// Remember to call Forget!  If you don't, you may end up tracking failures forever.
+func NewPriorityRateLimitingQueueWithConfig[T comparable](rateLimiter RateLimiter[T], config PriorityRateLimitingQueueConfig[T]) RateLimitingInterface[T] {
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+
+	if config.DelayingQueue == nil {
+		config.DelayingQueue = NewPriorityDelayingQueueWithConfig(PriorityDelayingQueueConfig[T]{
+			Name:            config.Name,
+			MetricsProvider: config.MetricsProvider,
+			Clock:           config.Clock,
+			DefaultPriority: config.DefaultPriority,
+		})
+	}
+
+	return &rateLimitingType[T]{
+		DelayingInterface: config.DelayingQueue,
+		rateLimiter:       rateLimiter,
+	}
+}
+
 // NewNamedRateLimitingQueue constructs a new named workqueue with rateLimited queuing ability.
 // Deprecated: Use NewRateLimitingQueueWithConfig instead.
 func NewNamedRateLimitingQueue[T comparable](rateLimiter RateLimiter[T], name string) RateLimitingInterface[T] {
@@ -110,6 +224,17 @@ func (q *rateLimitingType[T]) AddRateLimited(item T) {
 	q.DelayingInterface.AddAfter(item, q.rateLimiter.When(item))
 }
 
+// AddRateLimitedWithPriority is like AddRateLimited, but additionally passes priority through to the
+// underlying delaying queue when it supports it, so the item can jump ahead of lower-priority items
+// once both have cleared their rate-limit delay.
+func (q *rateLimitingType[T]) AddRateLimitedWithPriority(item T, priority int) {
+	if pq, ok := q.DelayingInterface.(PriorityDelayingInterface[T]); ok {
+		pq.AddAfterWithPriority(item, q.rateLimiter.When(item), priority)
+		return
+	}
+	q.AddRateLimited(item)
+}
+
 func (q *rateLimitingType[T]) NumRequeues(item T) int {
 	return q.rateLimiter.NumRequeues(item)
 }
@@ -117,3 +242,90 @@ func (q *rateLimitingType[T]) NumRequeues(item T) int {
 func (q *rateLimitingType[T]) Forget(item T) {
 	q.rateLimiter.Forget(item)
 }
+
+// Snapshot reports the current counts of ready and delayed items.
+func (q *rateLimitingType[T]) Snapshot() RateLimitingSnapshot[T] {
+	snapshot := RateLimitingSnapshot[T]{Ready: q.DelayingInterface.Len()}
+	if s, ok := q.DelayingInterface.(delayedSnapshotter[T]); ok {
+		snapshot.Delayed, snapshot.NextReadyAt = s.snapshotDelayed()
+	}
+	return snapshot
+}
+
+// Peek reports item's current backoff delay and requeue count without mutating rate limiter state.
+func (q *rateLimitingType[T]) Peek(item T) (delay time.Duration, requeues int, present bool) {
+	requeues = q.rateLimiter.NumRequeues(item)
+	if s, ok := q.DelayingInterface.(delayedSnapshotter[T]); ok {
+		delay, present = s.peekDelay(item)
+	}
+	return delay, requeues, present
+}
+
+// AddRateLimitedWithContext is like AddRateLimited, but aborts if ctx is cancelled before the
+// computed delay elapses.
+func (q *rateLimitingType[T]) AddRateLimitedWithContext(ctx context.Context, item T) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	before := q.rateLimiter.NumRequeues(item)
+	delay := q.rateLimiter.When(item)
+	if delay <= 0 {
+		q.DelayingInterface.AddAfter(item, 0)
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		q.undoRequeue(item, before)
+		return ctx.Err()
+	case <-timer.C:
+		q.DelayingInterface.AddAfter(item, 0)
+		return nil
+	}
+}
+
+// undoRequeue rolls back the counter bump from the When call that preceded a cancelled
+// AddRateLimitedWithContext. Calling Forget here would be worse than doing nothing: it wipes the
+// item's entire backoff history, not just the one (speculative) requeue this call counted. If the
+// limiter implements RequeueSeeder it can be restored to its exact prior count; otherwise the bump
+// is left in place, since an extra counted requeue is a far smaller problem than losing real
+// history.
+func (q *rateLimitingType[T]) undoRequeue(item T, before int) {
+	if seeder, ok := q.rateLimiter.(RequeueSeeder[T]); ok {
+		seeder.SeedRequeues(item, before)
+	}
+}
+
+// ShutDownAndDrain stops accepting new items, flushes all pending delayed items into the base
+// queue, and blocks until either every item in the base queue has been handed out and marked Done or
+// ctx is done.
+func (q *rateLimitingType[T]) ShutDownAndDrain(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		q.DelayingInterface.ShutDownWithDrain()
+		// The base queue's drain only waits for items already handed out by Get. Flushed items that
+		// are still queued must be handed out too, and then marked Done, before the drain is over.
+		for q.DelayingInterface.Len() > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		q.DelayingInterface.ShutDownWithDrain()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitingQueueSnapshotAndPeek(t *testing.T) {
+	limiter := newConstantRateLimiter(50 * time.Millisecond)
+	q := NewPriorityRateLimitingQueueWithConfig[string](limiter, PriorityRateLimitingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	q.AddRateLimited("item")
+
+	deadline := time.Now().Add(time.Second)
+	for q.Snapshot().Delayed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for item to show up as delayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	delay, requeues, present := q.Peek("item")
+	if !present {
+		t.Fatalf("expected Peek to find the pending item")
+	}
+	if requeues != 1 {
+		t.Fatalf("expected 1 requeue, got %d", requeues)
+	}
+	if delay <= 0 || delay > 50*time.Millisecond {
+		t.Fatalf("expected a positive delay of at most 50ms, got %s", delay)
+	}
+
+	if _, _, present := q.Peek("unknown"); present {
+		t.Fatalf("expected Peek on an unknown item to report absent")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	snap := q.Snapshot()
+	if snap.Ready != 1 || snap.Delayed != 0 {
+		t.Fatalf("expected the item to have become ready, got snapshot %+v", snap)
+	}
+}
+
+// TestRateLimitingQueueSnapshotConcurrentAccess exercises Snapshot/Peek racing with AddRateLimited
+// from other goroutines; run with -race to catch data races in the waiting heap's mutex.
+func TestRateLimitingQueueSnapshotConcurrentAccess(t *testing.T) {
+	limiter := newConstantRateLimiter(5 * time.Millisecond)
+	q := NewPriorityRateLimitingQueueWithConfig[string](limiter, PriorityRateLimitingQueueConfig[string]{})
+	defer q.ShutDown()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				q.AddRateLimitedWithPriority("item", i%3)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				q.Snapshot()
+				q.Peek("item")
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}